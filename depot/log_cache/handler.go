@@ -0,0 +1,61 @@
+package log_cache
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler serves a Loggregator log-cache style Read API over the local
+// Cache: GET /v1/read/{source_id}?source_type=...&envelope_type=LOG&log_type=OUT&start_time=...&end_time=...
+type Handler struct {
+	cache *Cache
+}
+
+func NewHandler(cache *Cache) *Handler {
+	return &Handler{cache: cache}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sourceID := r.URL.Query().Get("source_id")
+	if sourceID == "" {
+		http.Error(w, "source_id is required", http.StatusBadRequest)
+		return
+	}
+
+	opts := ReadOptions{
+		SourceID:     sourceID,
+		SourceType:   r.URL.Query().Get("source_type"),
+		EnvelopeType: r.URL.Query().Get("envelope_type"),
+		LogType:      r.URL.Query().Get("log_type"),
+	}
+
+	var err error
+	opts.StartTime, err = parseUnixNano(r.URL.Query().Get("start_time"))
+	if err != nil {
+		http.Error(w, "invalid start_time: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.EndTime, err = parseUnixNano(r.URL.Query().Get("end_time"))
+	if err != nil {
+		http.Error(w, "invalid end_time: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	envelopes := h.cache.Read(opts)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(envelopes)
+}
+
+func parseUnixNano(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	nanos, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanos), nil
+}
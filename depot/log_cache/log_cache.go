@@ -0,0 +1,156 @@
+// Package log_cache is a minimal, in-process analog of Loggregator's
+// log-cache: it keeps a short rolling window of recent container logs so
+// they can be read back directly from the executor without a full
+// Loggregator deployment.
+package log_cache
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSize is the number of envelopes retained per stream before
+	// the oldest entries are evicted.
+	DefaultSize = 1000
+
+	// EnvelopeTypeLog is the only Loggregator envelope_type the executor
+	// ever emits (as opposed to COUNTER, GAUGE, etc). It is distinct from
+	// Log.Type, which tells stdout from stderr.
+	EnvelopeTypeLog = "LOG"
+
+	// LogTypeOut and LogTypeErr are the values Log.Type takes, mirroring
+	// Loggregator's OUT/ERR log output types.
+	LogTypeOut = "OUT"
+	LogTypeErr = "ERR"
+)
+
+// Envelope mirrors the subset of a Loggregator v2 envelope that the
+// executor is able to reconstruct locally from a LogStreamer's output.
+type Envelope struct {
+	Timestamp    time.Time
+	SourceID     string
+	SourceType   string
+	InstanceID   string
+	Tags         map[string]string
+	EnvelopeType string
+	Log          Log
+}
+
+type Log struct {
+	Payload []byte
+	Type    string
+}
+
+type streamKey struct {
+	sourceID   string
+	sourceType string
+	instanceID string
+}
+
+// ReadOptions filters the envelopes returned by Cache.Read. EnvelopeType
+// filters on Envelope.EnvelopeType (e.g. "LOG"); LogType filters on
+// Log.Type ("OUT" or "ERR") and is independent of it.
+type ReadOptions struct {
+	SourceID     string
+	SourceType   string
+	EnvelopeType string
+	LogType      string
+	StartTime    time.Time
+	EndTime      time.Time
+}
+
+// Cache is a fixed-size, per-stream ring buffer of recent log envelopes.
+// A stream is identified by (source_id, source_type, instance_id), which
+// mirrors the key a LogStreamer tags every message with.
+type Cache struct {
+	mu      sync.RWMutex
+	size    int
+	streams map[streamKey][]Envelope
+	now     func() time.Time
+}
+
+// New creates a Cache that retains up to size envelopes per stream.
+func New(size int) *Cache {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Cache{
+		size:    size,
+		streams: make(map[streamKey][]Envelope),
+		now:     time.Now,
+	}
+}
+
+// Add appends an envelope to the cache, keyed by (sourceID, sourceType,
+// instanceID) pulled from tags. It is safe to call Add from the
+// LogStreamer's emit path since it never blocks on I/O.
+func (c *Cache) Add(sourceType string, tags map[string]string, message string, isError bool) {
+	logType := LogTypeOut
+	if isError {
+		logType = LogTypeErr
+	}
+
+	envelope := Envelope{
+		Timestamp:    c.now(),
+		SourceID:     tags["source_id"],
+		SourceType:   sourceType,
+		InstanceID:   tags["instance_id"],
+		Tags:         tags,
+		EnvelopeType: EnvelopeTypeLog,
+		Log: Log{
+			Payload: []byte(message),
+			Type:    logType,
+		},
+	}
+
+	key := streamKey{
+		sourceID:   envelope.SourceID,
+		sourceType: envelope.SourceType,
+		instanceID: envelope.InstanceID,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	buffer := append(c.streams[key], envelope)
+	if len(buffer) > c.size {
+		buffer = buffer[len(buffer)-c.size:]
+	}
+	c.streams[key] = buffer
+}
+
+// Read returns envelopes for opts.SourceID matching the given filters, in
+// the order they were added.
+func (c *Cache) Read(opts ReadOptions) []Envelope {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var results []Envelope
+	for key, buffer := range c.streams {
+		if key.sourceID != opts.SourceID {
+			continue
+		}
+		if opts.SourceType != "" && key.sourceType != opts.SourceType {
+			continue
+		}
+
+		for _, envelope := range buffer {
+			if opts.EnvelopeType != "" && envelope.EnvelopeType != opts.EnvelopeType {
+				continue
+			}
+			if opts.LogType != "" && envelope.Log.Type != opts.LogType {
+				continue
+			}
+			if !opts.StartTime.IsZero() && envelope.Timestamp.Before(opts.StartTime) {
+				continue
+			}
+			if !opts.EndTime.IsZero() && envelope.Timestamp.After(opts.EndTime) {
+				continue
+			}
+			results = append(results, envelope)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,56 @@
+package log_cache_test
+
+import (
+	"code.cloudfoundry.org/executor/depot/log_cache"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var cache *log_cache.Cache
+
+	BeforeEach(func() {
+		cache = log_cache.New(3)
+	})
+
+	It("reads back what was added, filtered by source id", func() {
+		cache.Add("APP", map[string]string{"source_id": "guid-1", "instance_id": "0"}, "hello", false)
+		cache.Add("APP", map[string]string{"source_id": "guid-2", "instance_id": "0"}, "other app", false)
+
+		envelopes := cache.Read(log_cache.ReadOptions{SourceID: "guid-1"})
+		Expect(envelopes).To(HaveLen(1))
+		Expect(string(envelopes[0].Log.Payload)).To(Equal("hello"))
+	})
+
+	It("filters by source type and log type", func() {
+		cache.Add("APP", map[string]string{"source_id": "guid-1", "instance_id": "0"}, "out", false)
+		cache.Add("APP", map[string]string{"source_id": "guid-1", "instance_id": "0"}, "err", true)
+		cache.Add("STG", map[string]string{"source_id": "guid-1", "instance_id": "0"}, "staging", false)
+
+		envelopes := cache.Read(log_cache.ReadOptions{SourceID: "guid-1", SourceType: "APP", LogType: log_cache.LogTypeErr})
+		Expect(envelopes).To(HaveLen(1))
+		Expect(string(envelopes[0].Log.Payload)).To(Equal("err"))
+	})
+
+	It("does not drop stderr envelopes when filtering by envelope_type=LOG", func() {
+		tags := map[string]string{"source_id": "guid-1", "instance_id": "0"}
+		cache.Add("APP", tags, "out", false)
+		cache.Add("APP", tags, "err", true)
+
+		envelopes := cache.Read(log_cache.ReadOptions{SourceID: "guid-1", EnvelopeType: log_cache.EnvelopeTypeLog})
+		Expect(envelopes).To(HaveLen(2))
+	})
+
+	It("evicts the oldest envelope once a stream exceeds its size", func() {
+		tags := map[string]string{"source_id": "guid-1", "instance_id": "0"}
+		cache.Add("APP", tags, "first", false)
+		cache.Add("APP", tags, "second", false)
+		cache.Add("APP", tags, "third", false)
+		cache.Add("APP", tags, "fourth", false)
+
+		envelopes := cache.Read(log_cache.ReadOptions{SourceID: "guid-1"})
+		Expect(envelopes).To(HaveLen(3))
+		Expect(string(envelopes[0].Log.Payload)).To(Equal("second"))
+		Expect(string(envelopes[2].Log.Payload)).To(Equal("fourth"))
+	})
+})
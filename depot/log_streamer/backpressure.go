@@ -0,0 +1,224 @@
+package log_streamer
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DropPolicy controls what happens when a LogStreamer's internal buffer
+// (see BufferSize) is full and a new line needs to be enqueued.
+type DropPolicy int
+
+const (
+	// DropNewest discards the line that just arrived, keeping whatever
+	// is already buffered.
+	DropNewest DropPolicy = iota
+
+	// DropOldest discards the oldest buffered line to make room for the
+	// one that just arrived.
+	DropOldest
+)
+
+// dropMarkerInterval rate-limits the synthetic "<N log lines dropped>"
+// messages so a sustained overflow doesn't itself flood the log.
+const dropMarkerInterval = time.Second
+
+// queuedMessage captures everything drain needs to emit a buffered line,
+// including the sourceName/tags of the LogStreamer that enqueued it — a
+// WithSource/With clone shares its root's queue and drain goroutine, so
+// that context can't be read off the root at drain time.
+type queuedMessage struct {
+	message    string
+	isError    bool
+	sourceName string
+	tags       map[string]string
+}
+
+// metrics is shared (via pointer) by a LogStreamer and every LogStreamer
+// derived from it through WithSource/With, so Dropped()/Enqueued() report
+// totals across the whole family of streamers backed by the same buffer.
+type metrics struct {
+	enqueued int64
+	dropped  int64
+}
+
+func (m *metrics) Enqueued() int64 {
+	return atomic.LoadInt64(&m.enqueued)
+}
+
+func (m *metrics) Dropped() int64 {
+	return atomic.LoadInt64(&m.dropped)
+}
+
+// BufferSize makes a LogStreamer write lines into a channel of this
+// capacity and drain them to the IngressClient from a background
+// goroutine, instead of sending synchronously on the calling goroutine.
+// This keeps a slow or unavailable Loggregator ingress from blocking a
+// container's stdout/stderr. A size of 0 (the default) disables
+// buffering entirely, preserving the original synchronous behavior.
+func BufferSize(size int) Option {
+	return func(s *logStreamer) {
+		s.bufferSize = size
+	}
+}
+
+// WithDropPolicy selects what happens when the BufferSize buffer is full.
+// It has no effect unless BufferSize is also set. Defaults to DropNewest.
+func WithDropPolicy(policy DropPolicy) Option {
+	return func(s *logStreamer) {
+		s.dropPolicy = policy
+	}
+}
+
+// startBuffering allocates the bounded channel and background drain
+// goroutine described by BufferSize/WithDropPolicy. It is a no-op unless
+// bufferSize is positive.
+func (e *logStreamer) startBuffering() {
+	if e.bufferSize <= 0 {
+		return
+	}
+
+	e.metrics = &metrics{}
+	e.queue = make(chan queuedMessage, e.bufferSize)
+	e.dropTimer = &dropTimer{metrics: e.metrics, emitMarker: e.emitDropMarker}
+
+	go e.drain()
+}
+
+// drain is the single goroutine that reads queue and forwards to the
+// IngressClient, for every LogStreamer sharing this buffer via
+// WithSource/With. It never closes queue itself — a producer goroutine
+// may still be selecting on a send to it — and instead stops pulling new
+// messages once ctx is done, draining whatever is already buffered first.
+func (e *logStreamer) drain() {
+	for {
+		select {
+		case msg, ok := <-e.queue:
+			if !ok {
+				return
+			}
+			e.emit(msg)
+		case <-e.ctx.Done():
+			e.drainBuffered()
+			return
+		}
+	}
+}
+
+// drainBuffered flushes whatever is already sitting in queue without
+// blocking for more, once ctx is done.
+func (e *logStreamer) drainBuffered() {
+	for {
+		select {
+		case msg, ok := <-e.queue:
+			if !ok {
+				return
+			}
+			e.emit(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (e *logStreamer) emit(msg queuedMessage) {
+	if msg.isError {
+		e.client.SendAppErrorLog(msg.message, msg.sourceName, msg.tags)
+	} else {
+		e.client.SendAppLog(msg.message, msg.sourceName, msg.tags)
+	}
+}
+
+// send either forwards message directly to the IngressClient (the
+// unbuffered default) or enqueues it for the drain goroutine, applying
+// DropPolicy if the buffer is full.
+func (e *logStreamer) send(message string, isError bool) {
+	if e.queue == nil {
+		if isError {
+			e.client.SendAppErrorLog(message, e.sourceName, e.tags)
+		} else {
+			e.client.SendAppLog(message, e.sourceName, e.tags)
+		}
+		return
+	}
+
+	select {
+	case <-e.ctx.Done():
+		atomic.AddInt64(&e.metrics.dropped, 1)
+		e.dropTimer.recordDrop()
+		return
+	default:
+	}
+
+	msg := queuedMessage{message: message, isError: isError, sourceName: e.sourceName, tags: e.tags}
+
+	select {
+	case e.queue <- msg:
+		atomic.AddInt64(&e.metrics.enqueued, 1)
+		return
+	default:
+	}
+
+	if e.dropPolicy == DropOldest {
+		select {
+		case <-e.queue:
+			atomic.AddInt64(&e.metrics.dropped, 1)
+		default:
+		}
+
+		select {
+		case e.queue <- msg:
+			atomic.AddInt64(&e.metrics.enqueued, 1)
+			return
+		default:
+		}
+	}
+
+	atomic.AddInt64(&e.metrics.dropped, 1)
+	e.dropTimer.recordDrop()
+}
+
+func (e *logStreamer) emitDropMarker(count int64) {
+	e.send(dropMarkerMessage(count), false)
+}
+
+// dropTimer coalesces drops into at most one "<N log lines dropped>"
+// marker per dropMarkerInterval.
+type dropTimer struct {
+	mutex      sync.Mutex
+	pending    int64
+	timer      *time.Timer
+	metrics    *metrics
+	emitMarker func(count int64)
+}
+
+func (d *dropTimer) recordDrop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.pending++
+	if d.timer == nil {
+		d.timer = time.AfterFunc(dropMarkerInterval, d.flush)
+	}
+}
+
+func (d *dropTimer) flush() {
+	d.mutex.Lock()
+	pending := d.pending
+	d.pending = 0
+	d.timer = nil
+	d.mutex.Unlock()
+
+	if pending > 0 {
+		d.emitMarker(pending)
+	}
+}
+
+func dropMarkerMessage(count int64) string {
+	if count == 1 {
+		return "<1 log line dropped>"
+	}
+	return "<" + strconv.FormatInt(count, 10) + " log lines dropped>"
+}
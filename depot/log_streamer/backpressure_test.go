@@ -0,0 +1,102 @@
+package log_streamer_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor/depot/log_streamer"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LogStreamer backpressure", func() {
+	var (
+		streamer   log_streamer.LogStreamer
+		fakeClient *mfakes.FakeIngressClient
+		ctx        context.Context
+		cancelFunc context.CancelFunc
+
+		ingressMutex sync.Mutex
+	)
+
+	const bufferSize = 4
+
+	BeforeEach(func() {
+		ctx, cancelFunc = context.WithCancel(context.Background())
+		fakeClient = &mfakes.FakeIngressClient{}
+
+		// Stall every send on a mutex the test holds, simulating a slow
+		// or unavailable Loggregator ingress.
+		ingressMutex.Lock()
+		fakeClient.SendAppLogStub = func(message, sourceType string, tags map[string]string) error {
+			ingressMutex.Lock()
+			defer ingressMutex.Unlock()
+			return nil
+		}
+
+		streamer = log_streamer.New(ctx, "the-guid", "the-source", 0, nil, fakeClient, log_streamer.BufferSize(bufferSize))
+	})
+
+	AfterEach(func() {
+		cancelFunc()
+	})
+
+	It("drops lines once the buffer is full and reports the drop count", func() {
+		for i := 0; i < bufferSize+10; i++ {
+			fmt.Fprintln(streamer.Stdout(), "line")
+		}
+
+		ingressMutex.Unlock()
+
+		Eventually(streamer.Dropped).Should(BeNumerically(">", 0))
+		Eventually(streamer.Enqueued).Should(BeNumerically(">", 0))
+		Expect(streamer.Dropped() + streamer.Enqueued()).To(BeNumerically(">=", int64(bufferSize+10)))
+	})
+
+	It("emits a rate-limited marker describing how many lines were dropped", func() {
+		for i := 0; i < bufferSize+10; i++ {
+			fmt.Fprintln(streamer.Stdout(), "line")
+		}
+
+		ingressMutex.Unlock()
+
+		// The marker is only flushed once dropMarkerInterval (1s) has
+		// elapsed since the first drop, so give Eventually enough room
+		// that it isn't racing the timer at Gomega's default 1s timeout.
+		Eventually(func() bool {
+			for i := 0; i < fakeClient.SendAppLogCallCount(); i++ {
+				message, _, _ := fakeClient.SendAppLogArgsForCall(i)
+				if containsDropMarker(message) {
+					return true
+				}
+			}
+			return false
+		}, 3*time.Second).Should(BeTrue())
+	})
+
+	It("attributes buffered lines from a WithSource clone to that clone's source, not the root's", func() {
+		stgStreamer := streamer.WithSource("STG")
+
+		fmt.Fprintln(streamer.Stdout(), "app line")
+		fmt.Fprintln(stgStreamer.Stdout(), "stg line")
+
+		ingressMutex.Unlock()
+
+		Eventually(fakeClient.SendAppLogCallCount).Should(BeNumerically(">=", 2))
+
+		sources := map[string]string{}
+		for i := 0; i < fakeClient.SendAppLogCallCount(); i++ {
+			message, sourceType, _ := fakeClient.SendAppLogArgsForCall(i)
+			sources[message] = sourceType
+		}
+		Expect(sources["app line"]).To(Equal("the-source"))
+		Expect(sources["stg line"]).To(Equal("STG"))
+	})
+})
+
+func containsDropMarker(message string) bool {
+	return len(message) > 0 && message[0] == '<'
+}
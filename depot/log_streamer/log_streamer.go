@@ -0,0 +1,392 @@
+package log_streamer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	MAX_MESSAGE_SIZE = 61440
+	DefaultLogSource = "LOG"
+)
+
+// IngressClient is the subset of the diego-logging-client used to emit
+// app logs to Loggregator. It is satisfied by diego-logging-client's
+// IngressClient and its testhelpers fake.
+type IngressClient interface {
+	SendAppLog(message, sourceType string, tags map[string]string) error
+	SendAppErrorLog(message, sourceType string, tags map[string]string) error
+}
+
+// LogStreamer buffers and forwards a container's stdout/stderr to an
+// IngressClient, splitting on newlines and on MAX_MESSAGE_SIZE.
+type LogStreamer interface {
+	Stdout() io.Writer
+	Stderr() io.Writer
+	Flush()
+	WithSource(sourceName string) LogStreamer
+	SourceName() string
+
+	// With returns a child LogStreamer carrying keyvals in addition to
+	// any it already has. keyvals must be an even-length list of
+	// alternating keys and values; an odd-length list logs an internal
+	// warning and drops the trailing key.
+	With(keyvals ...interface{}) LogStreamer
+
+	// Dropped and Enqueued report counters for the BufferSize buffer.
+	// Both are always 0 when BufferSize was not configured.
+	Dropped() int64
+	Enqueued() int64
+}
+
+// keyval is a single key/value pair attached via With.
+type keyval struct {
+	key   string
+	value interface{}
+}
+
+// LogCache is fed a copy of every envelope this package emits, in
+// addition to the IngressClient. It is satisfied by depot/log_cache's
+// Cache.
+type LogCache interface {
+	Add(sourceType string, tags map[string]string, message string, isError bool)
+}
+
+type logStreamer struct {
+	ctx      context.Context
+	guid     string
+	tags     map[string]string
+	client   IngressClient
+	logCache LogCache
+
+	sourceName     string
+	kvs            []keyval
+	structuredMode bool
+
+	bufferSize int
+	dropPolicy DropPolicy
+	queue      chan queuedMessage
+	metrics    *metrics
+	dropTimer  *dropTimer
+
+	stdout *logWriter
+	stderr *logWriter
+}
+
+// Option configures optional behavior on a LogStreamer created via New or
+// NewWithCache.
+type Option func(*logStreamer)
+
+// StructuredMode makes a LogStreamer emit its With() key/value pairs as a
+// JSON object (`{"msg":..., "kv":{...}}`) instead of a logfmt-style
+// prefix on the raw line.
+func StructuredMode() Option {
+	return func(s *logStreamer) {
+		s.structuredMode = true
+	}
+}
+
+// New creates a LogStreamer that tags every emitted envelope with guid,
+// sourceName and index before handing it to client. An empty guid makes
+// the streamer a no-op, and an empty sourceName defaults to DefaultLogSource.
+func New(ctx context.Context, guid, sourceName string, index int, tags map[string]string, client IngressClient, opts ...Option) LogStreamer {
+	return NewWithCache(ctx, guid, sourceName, index, tags, client, nil, opts...)
+}
+
+// NewWithCache behaves like New, but additionally mirrors every emitted
+// envelope into logCache so it can be served back out by a local
+// log-cache reader. logCache may be nil, in which case no mirroring
+// happens.
+func NewWithCache(ctx context.Context, guid, sourceName string, index int, tags map[string]string, client IngressClient, logCache LogCache, opts ...Option) LogStreamer {
+	if sourceName == "" {
+		sourceName = DefaultLogSource
+	}
+
+	streamerTags := make(map[string]string, len(tags)+2)
+	for k, v := range tags {
+		streamerTags[k] = v
+	}
+	streamerTags["source_id"] = guid
+	streamerTags["instance_id"] = strconv.Itoa(index)
+
+	streamer := &logStreamer{
+		ctx:        ctx,
+		guid:       guid,
+		tags:       streamerTags,
+		client:     client,
+		logCache:   logCache,
+		sourceName: sourceName,
+	}
+
+	for _, opt := range opts {
+		opt(streamer)
+	}
+	streamer.startBuffering()
+
+	streamer.stdout = newLogWriter(streamer, streamer.emitStdout)
+	streamer.stderr = newLogWriter(streamer, streamer.emitStderr)
+
+	return streamer
+}
+
+func (e *logStreamer) Stdout() io.Writer {
+	return e.stdout
+}
+
+func (e *logStreamer) Stderr() io.Writer {
+	return e.stderr
+}
+
+func (e *logStreamer) SourceName() string {
+	return e.sourceName
+}
+
+func (e *logStreamer) WithSource(sourceName string) LogStreamer {
+	if sourceName == "" {
+		return e
+	}
+
+	clone := *e
+	clone.sourceName = sourceName
+	clone.stdout = newLogWriter(&clone, clone.emitStdout)
+	clone.stderr = newLogWriter(&clone, clone.emitStderr)
+	return &clone
+}
+
+func (e *logStreamer) With(keyvals ...interface{}) LogStreamer {
+	if len(keyvals)%2 != 0 {
+		e.emitStderr(fmt.Sprintf("log_streamer: With() called with an odd number of keyvals (%d); dropping the trailing key", len(keyvals)))
+		keyvals = keyvals[:len(keyvals)-1]
+	}
+
+	clone := *e
+	clone.kvs = make([]keyval, len(e.kvs), len(e.kvs)+len(keyvals)/2)
+	copy(clone.kvs, e.kvs)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, _ := keyvals[i].(string)
+		clone.kvs = append(clone.kvs, keyval{key: key, value: keyvals[i+1]})
+	}
+
+	clone.stdout = newLogWriter(&clone, clone.emitStdout)
+	clone.stderr = newLogWriter(&clone, clone.emitStderr)
+	return &clone
+}
+
+func (e *logStreamer) Flush() {
+	e.stdout.flush()
+	e.stderr.flush()
+}
+
+func (e *logStreamer) emitStdout(message string) {
+	if e.guid == "" {
+		return
+	}
+	formatted := e.format(message)
+	e.send(formatted, false)
+	if e.logCache != nil {
+		e.logCache.Add(e.sourceName, e.tags, formatted, false)
+	}
+}
+
+func (e *logStreamer) emitStderr(message string) {
+	if e.guid == "" {
+		return
+	}
+	formatted := e.format(message)
+	e.send(formatted, true)
+	if e.logCache != nil {
+		e.logCache.Add(e.sourceName, e.tags, formatted, true)
+	}
+}
+
+func (e *logStreamer) Dropped() int64 {
+	if e.metrics == nil {
+		return 0
+	}
+	return e.metrics.Dropped()
+}
+
+func (e *logStreamer) Enqueued() int64 {
+	if e.metrics == nil {
+		return 0
+	}
+	return e.metrics.Enqueued()
+}
+
+// format applies the With() key/value context, if any, to message: a
+// logfmt-style prefix by default, or a JSON envelope under StructuredMode.
+func (e *logStreamer) format(message string) string {
+	if len(e.kvs) == 0 {
+		return message
+	}
+
+	if e.structuredMode {
+		payload, err := json.Marshal(struct {
+			Msg string                 `json:"msg"`
+			KV  map[string]interface{} `json:"kv"`
+		}{Msg: message, KV: e.kvMap()})
+		if err != nil {
+			return message
+		}
+		return string(payload)
+	}
+
+	return e.logfmtPrefix() + " " + message
+}
+
+func (e *logStreamer) kvMap() map[string]interface{} {
+	m := make(map[string]interface{}, len(e.kvs))
+	for _, kv := range e.kvs {
+		m[kv.key] = kv.value
+	}
+	return m
+}
+
+func (e *logStreamer) logfmtPrefix() string {
+	parts := make([]string, len(e.kvs))
+	for i, kv := range e.kvs {
+		parts[i] = kv.key + "=" + logfmtValue(kv.value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func logfmtValue(value interface{}) string {
+	s := fmt.Sprintf("%v", value)
+	if strings.ContainsAny(s, " \t\"") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// overhead is the number of bytes format() adds on top of the raw
+// message; it must be subtracted from MAX_MESSAGE_SIZE so a split line's
+// formatted size never exceeds the wire limit.
+func (e *logStreamer) overhead() int {
+	if len(e.kvs) == 0 {
+		return 0
+	}
+	return len(e.format(""))
+}
+
+// logWriter accumulates bytes written to it, emitting one message per
+// line (terminated by \n or \r) and force-splitting any line that grows
+// past MAX_MESSAGE_SIZE bytes.
+type logWriter struct {
+	mutex   sync.Mutex
+	buffer  []byte
+	emit    func(string)
+	maxSize func() int
+	ctxDone func() error
+}
+
+func newLogWriter(e *logStreamer, emit func(string)) *logWriter {
+	return &logWriter{
+		emit: emit,
+		maxSize: func() int {
+			max := MAX_MESSAGE_SIZE - e.overhead()
+			if max < 1 {
+				max = 1
+			}
+			return max
+		},
+		ctxDone: func() error {
+			select {
+			case <-e.ctx.Done():
+				return e.ctx.Err()
+			default:
+				return nil
+			}
+		},
+	}
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	if err := w.ctxDone(); err != nil {
+		return 0, err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, data...)
+
+	for {
+		idx := indexAny(w.buffer, "\n\r")
+		if idx == -1 {
+			break
+		}
+
+		w.emitChunks(w.buffer[:idx])
+		w.buffer = w.buffer[idx+1:]
+	}
+
+	// force-split whatever is left if it has grown past the limit
+	max := w.maxSize()
+	for len(w.buffer) >= max {
+		chunk, rest := splitChunk(w.buffer, max)
+		w.emit(string(chunk))
+		w.buffer = rest
+	}
+
+	return len(data), nil
+}
+
+func (w *logWriter) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.buffer) > 0 {
+		w.emitChunks(w.buffer)
+		w.buffer = nil
+	}
+}
+
+// emitChunks emits line in maxSize()-sized pieces, skipping an empty line.
+func (w *logWriter) emitChunks(line []byte) {
+	max := w.maxSize()
+	for len(line) >= max {
+		chunk, rest := splitChunk(line, max)
+		w.emit(string(chunk))
+		line = rest
+	}
+	if len(line) > 0 {
+		w.emit(string(line))
+	}
+}
+
+func indexAny(buf []byte, chars string) int {
+	for i, b := range buf {
+		for _, c := range []byte(chars) {
+			if b == c {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitChunk takes up to max bytes off the front of buf, backing off to
+// the nearest rune boundary so a multi-byte UTF-8 character is never
+// split across two emitted messages. If no safe boundary can be found
+// within a rune's width of max, it falls back to a hard cut a few bytes
+// short of max rather than risk emitting a mangled rune.
+func splitChunk(buf []byte, max int) (chunk, rest []byte) {
+	if len(buf) <= max {
+		return buf, nil
+	}
+
+	cut := max
+	for i := 0; i < utf8.UTFMax && cut > 0 && !utf8.RuneStart(buf[cut]); i++ {
+		cut--
+	}
+	if max-cut >= utf8.UTFMax {
+		cut = max - utf8.UTFMax + 1
+	}
+	return buf[:cut], buf[cut:]
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	mfakes "code.cloudfoundry.org/diego-logging-client/testhelpers"
+	"code.cloudfoundry.org/executor/depot/log_cache"
 	"code.cloudfoundry.org/executor/depot/log_streamer"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -90,6 +91,83 @@ var _ = Describe("LogStreamer", func() {
 			})
 		})
 
+		Describe("With", func() {
+			It("prepends a logfmt-style key/value prefix to emitted messages", func() {
+				streamer = streamer.With("request-id", "abc-123", "phase", "staging")
+				fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+				message, _, _ := fakeClient.SendAppLogArgsForCall(0)
+				Expect(message).To(Equal(`request-id=abc-123 phase=staging this is a log`))
+			})
+
+			It("quotes values containing whitespace", func() {
+				streamer = streamer.With("detail", "value with space")
+				fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+				message, _, _ := fakeClient.SendAppLogArgsForCall(0)
+				Expect(message).To(Equal(`detail="value with space" this is a log`))
+			})
+
+			It("nests, accumulating keyvals from each With() in order", func() {
+				streamer = streamer.With("a", "1").With("b", "2")
+				fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+				message, _, _ := fakeClient.SendAppLogArgsForCall(0)
+				Expect(message).To(Equal("a=1 b=2 this is a log"))
+			})
+
+			It("logs an internal warning and drops the trailing key when given an odd number of keyvals", func() {
+				streamer = streamer.With("a", "1", "orphan")
+
+				Expect(fakeClient.SendAppErrorLogCallCount()).To(Equal(1))
+				warning, _, _ := fakeClient.SendAppErrorLogArgsForCall(0)
+				Expect(warning).To(ContainSubstring("odd number of keyvals"))
+
+				fmt.Fprintln(streamer.Stdout(), "this is a log")
+				message, _, _ := fakeClient.SendAppLogArgsForCall(0)
+				Expect(message).To(Equal("a=1 this is a log"))
+			})
+
+			It("composes with WithSource", func() {
+				streamer = streamer.With("a", "1").WithSource("new-source-name")
+				fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+				message, sn, _ := fakeClient.SendAppLogArgsForCall(0)
+				Expect(sn).To(Equal("new-source-name"))
+				Expect(message).To(Equal("a=1 this is a log"))
+			})
+
+			Context("when splitting a message that exceeds the emittable length", func() {
+				It("counts the prefix against MAX_MESSAGE_SIZE and re-emits it on every split line", func() {
+					streamer = streamer.With("a", "1")
+					message := strings.Repeat("7", log_streamer.MAX_MESSAGE_SIZE)
+					fmt.Fprintf(streamer.Stdout(), message+"\n")
+
+					Expect(fakeClient.SendAppLogCallCount()).To(Equal(2))
+
+					first, _, _ := fakeClient.SendAppLogArgsForCall(0)
+					Expect(first).To(HavePrefix("a=1 "))
+
+					second, _, _ := fakeClient.SendAppLogArgsForCall(1)
+					Expect(second).To(HavePrefix("a=1 "))
+				})
+			})
+
+			Describe("StructuredMode", func() {
+				BeforeEach(func() {
+					streamer = log_streamer.New(ctx, guid, sourceName, index, tags, fakeClient, log_streamer.StructuredMode())
+				})
+
+				It("emits a JSON envelope carrying the message and its keyvals", func() {
+					streamer = streamer.With("request-id", "abc-123")
+					fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+					message, _, _ := fakeClient.SendAppLogArgsForCall(0)
+					Expect(message).To(MatchJSON(`{"msg":"this is a log","kv":{"request-id":"abc-123"}}`))
+				})
+			})
+		})
+
 		Describe("SourceName", func() {
 			It("should return the log streamer's configured source name", func() {
 				Expect(streamer.SourceName()).To(Equal(sourceName))
@@ -374,4 +452,37 @@ var _ = Describe("LogStreamer", func() {
 			Expect(stdErrErr).To(HaveOccurred())
 		})
 	})
+
+	Describe("NewWithCache", func() {
+		var cache *log_cache.Cache
+
+		BeforeEach(func() {
+			cache = log_cache.New(log_cache.DefaultSize)
+			streamer = log_streamer.NewWithCache(ctx, guid, sourceName, index, tags, fakeClient, cache)
+		})
+
+		It("mirrors every emitted log into the cache alongside the ingress client", func() {
+			fmt.Fprintln(streamer.Stdout(), "this is a log")
+			fmt.Fprintln(streamer.Stderr(), "this is an error")
+
+			Expect(fakeClient.SendAppLogCallCount()).To(Equal(1))
+			Expect(fakeClient.SendAppErrorLogCallCount()).To(Equal(1))
+
+			envelopes := cache.Read(log_cache.ReadOptions{SourceID: guid})
+			Expect(envelopes).To(HaveLen(2))
+			Expect(string(envelopes[0].Log.Payload)).To(Equal("this is a log"))
+			Expect(envelopes[0].Log.Type).To(Equal(log_cache.LogTypeOut))
+			Expect(envelopes[0].EnvelopeType).To(Equal(log_cache.EnvelopeTypeLog))
+			Expect(string(envelopes[1].Log.Payload)).To(Equal("this is an error"))
+			Expect(envelopes[1].Log.Type).To(Equal(log_cache.LogTypeErr))
+			Expect(envelopes[1].EnvelopeType).To(Equal(log_cache.EnvelopeTypeLog))
+		})
+
+		It("does not mirror into the cache when there is no app guid", func() {
+			streamer = log_streamer.NewWithCache(ctx, "", sourceName, index, tags, fakeClient, cache)
+			fmt.Fprintln(streamer.Stdout(), "this is a log")
+
+			Expect(cache.Read(log_cache.ReadOptions{SourceID: ""})).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,325 @@
+// Package extractor extracts compressed archives (zip and various
+// tar-based formats) onto disk, deleting the source archive once it has
+// been fully extracted.
+package extractor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes read from an archive in order
+// to identify its format; it must be at least as large as the longest
+// registered magic number.
+const sniffLen = 6
+
+// ArchiveEntry is a single file, directory or symlink inside an archive,
+// already decompressed and ready to be copied to disk.
+type ArchiveEntry struct {
+	Name       string
+	Mode       os.FileMode
+	IsDir      bool
+	IsSymlink  bool
+	LinkTarget string
+	Body       io.Reader
+}
+
+// ArchiveReader iterates over the entries of an opened archive. Next
+// returns io.EOF once there are no more entries.
+type ArchiveReader interface {
+	Next() (*ArchiveEntry, error)
+	Close() error
+}
+
+// format pairs a magic-byte sniffer with a constructor for reading an
+// archive of that kind.
+type format struct {
+	name string
+	sniff func(header []byte) bool
+	open  func(path string) (ArchiveReader, error)
+}
+
+var formats []format
+
+// Register adds a new archive format to the registry. sniff is handed up
+// to sniffLen leading bytes of the archive and should report whether
+// they match this format's magic number. open is only called once sniff
+// has matched, and should return an ArchiveReader over the full archive
+// at path.
+func Register(name string, sniff func(header []byte) bool, open func(path string) (ArchiveReader, error)) {
+	formats = append(formats, format{name: name, sniff: sniff, open: open})
+}
+
+// Options controls how strictly ExtractWithOptions validates an archive
+// before trusting its contents.
+type Options struct {
+	// AllowSymlinks permits symlink entries, provided their resolved
+	// target stays inside dest. When false, any symlink entry fails the
+	// extraction with ErrPathEscape.
+	AllowSymlinks bool
+
+	// MaxUncompressedBytes, if positive, aborts extraction once the
+	// total bytes written across all entries would exceed it.
+	MaxUncompressedBytes int64
+
+	// MaxFiles, if positive, aborts extraction once more than this many
+	// entries have been processed.
+	MaxFiles int
+
+	// MaxPathDepth, if positive, rejects any entry whose path has more
+	// than this many components.
+	MaxPathDepth int
+}
+
+var (
+	// ErrPathEscape is returned when an entry's path (or, with
+	// AllowSymlinks, its resolved symlink target) would land outside
+	// the extraction destination.
+	ErrPathEscape = errors.New("extractor: archive entry would extract outside the destination directory")
+
+	// ErrSizeLimit is returned when an archive's total uncompressed size
+	// exceeds Options.MaxUncompressedBytes.
+	ErrSizeLimit = errors.New("extractor: archive exceeds the configured uncompressed size limit")
+
+	// ErrFileCountLimit is returned when an archive contains more
+	// entries than Options.MaxFiles.
+	ErrFileCountLimit = errors.New("extractor: archive exceeds the configured file count limit")
+)
+
+// Extract extracts the archive at src into dest, creating directories as
+// needed and preserving file permissions, then deletes src. It is
+// equivalent to ExtractWithOptions with AllowSymlinks set and no limits;
+// callers handling untrusted archives should use ExtractWithOptions
+// directly with stricter Options.
+func Extract(src, dest string) error {
+	return ExtractWithOptions(src, dest, Options{AllowSymlinks: true})
+}
+
+// ExtractWithOptions extracts the archive at src into dest as Extract
+// does, additionally validating every entry against opts so that a
+// malicious archive (path traversal, a symlink escaping dest, or an
+// excessive number of files/bytes) is rejected with a typed error rather
+// than being partially extracted.
+func ExtractWithOptions(src, dest string, opts Options) error {
+	f, ok := identify(src)
+	if !ok {
+		return fmt.Errorf("extractor: unrecognized archive format: %s", src)
+	}
+
+	reader, err := f.open(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := extractEntries(reader, dest, opts); err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+func identify(src string) (format, bool) {
+	header, err := readHeader(src)
+	if err != nil {
+		return format{}, false
+	}
+
+	for _, f := range formats {
+		if f.sniff(header) {
+			return f, true
+		}
+	}
+
+	return format{}, false
+}
+
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// ExtractManifest reports what an extraction actually wrote: the total
+// number of uncompressed bytes, and the destination path of every entry
+// (useful to a caller that needs to hash the resulting files).
+type ExtractManifest struct {
+	BytesWritten int64
+	Paths        []string
+}
+
+func extractEntries(reader ArchiveReader, dest string, opts Options) error {
+	_, err := extractEntriesManifest(reader, dest, opts)
+	return err
+}
+
+func extractEntriesManifest(reader ArchiveReader, dest string, opts Options) (ExtractManifest, error) {
+	cleanDest := filepath.Clean(dest)
+
+	var manifest ExtractManifest
+	var fileCount int
+
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF {
+			return manifest, nil
+		}
+		if err != nil {
+			return manifest, err
+		}
+
+		fileCount++
+		if opts.MaxFiles > 0 && fileCount > opts.MaxFiles {
+			return manifest, fmt.Errorf("%w: more than %d entries", ErrFileCountLimit, opts.MaxFiles)
+		}
+
+		if opts.MaxPathDepth > 0 && pathDepth(entry.Name) > opts.MaxPathDepth {
+			return manifest, fmt.Errorf("%w: %s has more than %d path components", ErrPathEscape, entry.Name, opts.MaxPathDepth)
+		}
+
+		target, err := safeJoin(cleanDest, entry.Name)
+		if err != nil {
+			return manifest, err
+		}
+
+		switch {
+		case entry.IsDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return manifest, err
+			}
+
+		case entry.IsSymlink:
+			if !opts.AllowSymlinks {
+				return manifest, fmt.Errorf("%w: %s is a symlink", ErrPathEscape, entry.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return manifest, err
+			}
+			if err := writeSymlink(cleanDest, target, entry.LinkTarget); err != nil {
+				return manifest, err
+			}
+			manifest.Paths = append(manifest.Paths, target)
+
+		default:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return manifest, err
+			}
+
+			written, err := writeFile(target, entry.Body, entry.Mode, opts.MaxUncompressedBytes-manifest.BytesWritten, opts.MaxUncompressedBytes > 0)
+			if err != nil {
+				return manifest, err
+			}
+			manifest.BytesWritten += written
+			manifest.Paths = append(manifest.Paths, target)
+		}
+	}
+}
+
+// safeJoin resolves name against cleanDest and rejects it with
+// ErrPathEscape if an absolute path or a run of ".." components would
+// land the extracted entry outside cleanDest (the "zip slip" class of
+// bug).
+func safeJoin(cleanDest, name string) (string, error) {
+	target := filepath.Clean(filepath.Join(cleanDest, name))
+	if target != cleanDest && !strings.HasPrefix(target, cleanDest+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: %s", ErrPathEscape, name)
+	}
+	return target, nil
+}
+
+func pathDepth(name string) int {
+	name = filepath.ToSlash(filepath.Clean(name))
+	if name == "." || name == "" {
+		return 0
+	}
+	return len(strings.Split(name, "/"))
+}
+
+// writeSymlink creates a symlink at target pointing at linkTarget, then
+// re-resolves it with filepath.EvalSymlinks to make sure the real path it
+// points at is still inside cleanDest — guarding against a symlink whose
+// target only escapes once it is actually followed (TOCTOU). If the link
+// target doesn't exist yet (a dangling symlink, or one that forward-
+// references an entry later in the same archive), EvalSymlinks can't walk
+// it; fall back to a lexical check of the cleaned link target instead of
+// rejecting an otherwise legitimate archive.
+func writeSymlink(cleanDest, target, linkTarget string) error {
+	os.Remove(target)
+	if err := os.Symlink(linkTarget, target); err != nil {
+		return err
+	}
+
+	resolved, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			os.Remove(target)
+			return err
+		}
+		resolved = lexicalSymlinkTarget(target, linkTarget)
+	}
+
+	if resolved != cleanDest && !strings.HasPrefix(resolved, cleanDest+string(os.PathSeparator)) {
+		os.Remove(target)
+		return fmt.Errorf("%w: symlink %s resolves outside the destination", ErrPathEscape, target)
+	}
+
+	return nil
+}
+
+// lexicalSymlinkTarget cleans linkTarget relative to the directory
+// containing target, without requiring the target to exist on disk.
+func lexicalSymlinkTarget(target, linkTarget string) string {
+	if filepath.IsAbs(linkTarget) {
+		return filepath.Clean(linkTarget)
+	}
+	return filepath.Clean(filepath.Join(filepath.Dir(target), linkTarget))
+}
+
+// writeFile copies body to target, honoring mode, and returns the number
+// of bytes written. If enforceLimit is set, it aborts as soon as more
+// than remaining bytes have been written, returning ErrSizeLimit and
+// leaving a partially-written file behind.
+func writeFile(target string, body io.Reader, mode os.FileMode, remaining int64, enforceLimit bool) (int64, error) {
+	if mode == 0 {
+		mode = 0644
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	if !enforceLimit {
+		written, err := io.Copy(out, body)
+		return written, err
+	}
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	// Read one byte past the limit so we can tell a file that exactly
+	// fills the budget apart from one that overflows it.
+	written, err := io.Copy(out, io.LimitReader(body, remaining+1))
+	if err != nil {
+		return written, err
+	}
+	if written > remaining {
+		return written, ErrSizeLimit
+	}
+	return written, nil
+}
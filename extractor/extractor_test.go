@@ -1,6 +1,7 @@
 package extractor_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -93,4 +94,243 @@ var _ = Describe("Extractor", func() {
 			cleanupTest()
 		})
 	})
+
+	Context("when the file is a tar.xz archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.xz"
+		})
+
+		It("extracts the tar.xz's files, generating directories, and honoring file permissions", func() {
+			extractionTest()
+		})
+
+		It("deletes the tar.xz file when its done", func() {
+			cleanupTest()
+		})
+	})
+
+	Context("when the file is a tar.bz2 archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.bz2"
+		})
+
+		It("extracts the tar.bz2's files, generating directories, and honoring file permissions", func() {
+			extractionTest()
+		})
+
+		It("deletes the tar.bz2 file when its done", func() {
+			cleanupTest()
+		})
+	})
+
+	Context("when the file is a tar.zst archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.zst"
+		})
+
+		It("extracts the tar.zst's files, generating directories, and honoring file permissions", func() {
+			extractionTest()
+		})
+
+		It("deletes the tar.zst file when its done", func() {
+			cleanupTest()
+		})
+	})
+})
+
+var _ = Describe("ExtractWithOptions", func() {
+	var extractionDest string
+	var extractionSrc string
+	var tempDir string
+	var archiveFixture string
+
+	JustBeforeEach(func() {
+		var err error
+
+		tempDir, err = ioutil.TempDir("", "extractor-fixture")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		extractionSrc = filepath.Join(tempDir, archiveFixture)
+
+		err = exec.Command("cp", "../fixtures/"+archiveFixture, extractionSrc).Run()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		extractionDest, err = ioutil.TempDir(os.TempDir(), "extracted")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(extractionDest)
+		os.RemoveAll(tempDir)
+	})
+
+	Context("when an entry's path escapes the destination with ..", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture_path_escape.zip"
+		})
+
+		It("rejects the archive with ErrPathEscape without writing anything under the destination", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{})
+			Ω(errors.Is(err, ErrPathEscape)).Should(BeTrue())
+
+			entries, err := ioutil.ReadDir(extractionDest)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(BeEmpty())
+		})
+	})
+
+	Context("when an entry is a symlink pointing outside the destination", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture_symlink_escape.zip"
+		})
+
+		It("rejects the archive with ErrPathEscape when symlinks are disallowed", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{AllowSymlinks: false})
+			Ω(errors.Is(err, ErrPathEscape)).Should(BeTrue())
+		})
+
+		It("rejects the archive with ErrPathEscape even when symlinks are allowed, since it resolves outside dest", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{AllowSymlinks: true})
+			Ω(errors.Is(err, ErrPathEscape)).Should(BeTrue())
+		})
+	})
+
+	Context("when an entry is a symlink whose target doesn't exist yet", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture_symlink_dangling.zip"
+		})
+
+		It("extracts it without error, since the resolved target is still inside dest", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{AllowSymlinks: true})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			target, err := os.Readlink(filepath.Join(extractionDest, "dangling_link"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(target).Should(Equal("missing_file"))
+		})
+	})
+
+	Context("when the archive exceeds the configured uncompressed size limit", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture_oversized.zip"
+		})
+
+		It("aborts with ErrSizeLimit", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{MaxUncompressedBytes: 1024})
+			Ω(errors.Is(err, ErrSizeLimit)).Should(BeTrue())
+		})
+	})
+
+	Context("when the archive exceeds the configured file count limit", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.zip"
+		})
+
+		It("aborts with ErrFileCountLimit", func() {
+			err := ExtractWithOptions(extractionSrc, extractionDest, Options{MaxFiles: 1})
+			Ω(errors.Is(err, ErrFileCountLimit)).Should(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("ExtractStream", func() {
+	var extractionDest string
+	var archiveFixture string
+	var hint Format
+
+	BeforeEach(func() {
+		var err error
+		extractionDest, err = ioutil.TempDir(os.TempDir(), "extracted-stream")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(extractionDest)
+	})
+
+	var streamTest = func() {
+		f, err := os.Open(filepath.Join("../fixtures", archiveFixture))
+		Ω(err).ShouldNot(HaveOccurred())
+		defer f.Close()
+
+		manifest, err := ExtractStream(f, extractionDest, hint, Options{AllowSymlinks: true})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(manifest.BytesWritten).Should(BeNumerically(">", 0))
+		Ω(manifest.Paths).ShouldNot(BeEmpty())
+
+		fileContents, err := ioutil.ReadFile(filepath.Join(extractionDest, "fixture", "file"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(fileContents)).Should(Equal("I am a file"))
+
+		Ω(manifest.Paths).Should(ContainElement(filepath.Join(extractionDest, "fixture", "file")))
+
+		// the source archive is untouched; ExtractStream only deletes
+		// what Extract/ExtractWithOptions were handed as a path.
+		_, err = os.Stat(filepath.Join("../fixtures", archiveFixture))
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	Context("when the stream is a tgz archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tgz"
+			hint = FormatTarGzip
+		})
+
+		It("extracts it directly from the reader, without spooling to disk", func() {
+			streamTest()
+		})
+	})
+
+	Context("when the stream is a tar.xz archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.xz"
+			hint = FormatTarXz
+		})
+
+		It("extracts it directly from the reader, without spooling to disk", func() {
+			streamTest()
+		})
+	})
+
+	Context("when the stream is a tar.bz2 archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.bz2"
+			hint = FormatTarBzip2
+		})
+
+		It("extracts it directly from the reader, without spooling to disk", func() {
+			streamTest()
+		})
+	})
+
+	Context("when the stream is a tar.zst archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.tar.zst"
+			hint = FormatTarZstd
+		})
+
+		It("extracts it directly from the reader, without spooling to disk", func() {
+			streamTest()
+		})
+	})
+
+	Context("when the stream is a zip archive", func() {
+		BeforeEach(func() {
+			archiveFixture = "fixture.zip"
+			hint = FormatZip
+		})
+
+		It("spools the reader to a temp file before extracting, then cleans it up", func() {
+			streamTest()
+		})
+
+		It("rejects a stream that exceeds the configured size limit before opening it", func() {
+			f, err := os.Open(filepath.Join("../fixtures", archiveFixture))
+			Ω(err).ShouldNot(HaveOccurred())
+			defer f.Close()
+
+			_, err = ExtractStream(f, extractionDest, hint, Options{MaxUncompressedBytes: 1})
+			Ω(errors.Is(err, ErrSizeLimit)).Should(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,87 @@
+package extractor
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	zipMagic   = []byte{'P', 'K', 0x03, 0x04}
+	gzipMagic  = []byte{0x1f, 0x8b}
+	xzMagic    = []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
+	bzip2Magic = []byte{'B', 'Z', 'h'}
+	zstdMagic  = []byte{0x28, 0xB5, 0x2F, 0xFD}
+)
+
+func init() {
+	Register("zip", hasPrefix(zipMagic), openZip)
+	Register("tgz", hasPrefix(gzipMagic), openTarGzip)
+	Register("tar.xz", hasPrefix(xzMagic), openTarXz)
+	Register("tar.bz2", hasPrefix(bzip2Magic), openTarBzip2)
+	Register("tar.zst", hasPrefix(zstdMagic), openTarZstd)
+}
+
+func hasPrefix(magic []byte) func([]byte) bool {
+	return func(header []byte) bool {
+		return bytes.HasPrefix(header, magic)
+	}
+}
+
+func openTarGzip(path string) (ArchiveReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return extractTarStream(gz, f), nil
+}
+
+func openTarXz(path string) (ArchiveReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	xr, err := xz.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return extractTarStream(xr, f), nil
+}
+
+func openTarBzip2(path string) (ArchiveReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractTarStream(bzip2.NewReader(f), f), nil
+}
+
+func openTarZstd(path string) (ArchiveReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return extractTarStream(zr.IOReadCloser(), f), nil
+}
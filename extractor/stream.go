@@ -0,0 +1,117 @@
+package extractor
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format names a supported archive format, for callers of ExtractStream
+// that already know what they're receiving (e.g. from a Content-Type or
+// a droplet's declared format) and so have no archive on disk to sniff.
+type Format string
+
+const (
+	FormatZip      Format = "zip"
+	FormatTarGzip  Format = "tgz"
+	FormatTarXz    Format = "tar.xz"
+	FormatTarBzip2 Format = "tar.bz2"
+	FormatTarZstd  Format = "tar.zst"
+)
+
+// ExtractStream extracts an archive of the given hint format directly
+// from r, without requiring the whole archive to already be on disk. This
+// lets a droplet download be piped straight into extraction. opts is
+// applied exactly as in ExtractWithOptions, which matters here more than
+// ever: r is typically an untrusted network stream, so callers should set
+// MaxUncompressedBytes/MaxFiles/MaxPathDepth rather than pass the zero
+// value. Unlike Extract/ExtractWithOptions, there is no source file to
+// delete when it's done.
+//
+// Tar-based formats stream straight through archive/tar as r is read. Zip
+// needs random access to its central directory, so it is spooled to a
+// temporary file that is removed once extraction finishes; opts.MaxUncompressedBytes,
+// if set, also bounds that spool so an oversized upload can't fill disk
+// before the archive is even opened.
+func ExtractStream(r io.Reader, dest string, hint Format, opts Options) (ExtractManifest, error) {
+	if hint == FormatZip {
+		return extractZipStream(r, dest, opts)
+	}
+
+	decompressed, err := decompress(hint, r)
+	if err != nil {
+		return ExtractManifest{}, err
+	}
+
+	reader := extractTarStream(decompressed, decompressed)
+	defer reader.Close()
+
+	return extractEntriesManifest(reader, dest, opts)
+}
+
+func decompress(hint Format, r io.Reader) (io.ReadCloser, error) {
+	switch hint {
+	case FormatTarGzip:
+		return gzip.NewReader(r)
+	case FormatTarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case FormatTarBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case FormatTarZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("extractor: ExtractStream does not support format %q", hint)
+	}
+}
+
+// extractZipStream spools r to a temporary file, since archive/zip needs
+// to seek to the central directory at the end of the archive, then
+// extracts it exactly as the path-based entry point would. The spool
+// itself is bounded by opts.MaxUncompressedBytes, if set, so an
+// oversized upload is rejected before a zip reader is ever opened on it.
+func extractZipStream(r io.Reader, dest string, opts Options) (ExtractManifest, error) {
+	tmp, err := ioutil.TempFile("", "extractor-stream-*.zip")
+	if err != nil {
+		return ExtractManifest{}, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if opts.MaxUncompressedBytes > 0 {
+		r = io.LimitReader(r, opts.MaxUncompressedBytes+1)
+	}
+
+	written, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return ExtractManifest{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return ExtractManifest{}, err
+	}
+	if opts.MaxUncompressedBytes > 0 && written > opts.MaxUncompressedBytes {
+		return ExtractManifest{}, ErrSizeLimit
+	}
+
+	reader, err := openZip(tmpPath)
+	if err != nil {
+		return ExtractManifest{}, err
+	}
+	defer reader.Close()
+
+	return extractEntriesManifest(reader, dest, opts)
+}
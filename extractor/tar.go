@@ -0,0 +1,58 @@
+package extractor
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+)
+
+// tarArchiveReader adapts an archive/tar.Reader, sitting on top of any
+// decompressed byte stream, to the ArchiveReader interface.
+type tarArchiveReader struct {
+	tr     *tar.Reader
+	closer io.Closer
+}
+
+// extractTarStream wraps a decompressed tar byte stream (the output of
+// gzip, xz, bzip2 or zstd decompression) as an ArchiveReader. closer is
+// closed alongside the returned reader, so callers can thread through
+// the underlying compressor and/or file handle.
+func extractTarStream(r io.Reader, closer io.Closer) ArchiveReader {
+	return &tarArchiveReader{tr: tar.NewReader(r), closer: closer}
+}
+
+func (t *tarArchiveReader) Next() (*ArchiveEntry, error) {
+	for {
+		header, err := t.tr.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return &ArchiveEntry{Name: header.Name, IsDir: true}, nil
+		case tar.TypeReg, tar.TypeRegA:
+			return &ArchiveEntry{
+				Name: header.Name,
+				Mode: os.FileMode(header.Mode),
+				Body: t.tr,
+			}, nil
+		case tar.TypeSymlink:
+			return &ArchiveEntry{
+				Name:       header.Name,
+				IsSymlink:  true,
+				LinkTarget: header.Linkname,
+			}, nil
+		default:
+			// hardlinks, devices, etc. are not supported; skip them.
+			continue
+		}
+	}
+}
+
+func (t *tarArchiveReader) Close() error {
+	if t.closer != nil {
+		return t.closer.Close()
+	}
+	return nil
+}
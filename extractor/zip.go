@@ -0,0 +1,74 @@
+package extractor
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+type zipArchiveReader struct {
+	rc    *zip.ReadCloser
+	files []*zip.File
+	idx   int
+
+	current io.ReadCloser
+}
+
+func openZip(path string) (ArchiveReader, error) {
+	rc, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &zipArchiveReader{rc: rc, files: rc.File}, nil
+}
+
+func (z *zipArchiveReader) Next() (*ArchiveEntry, error) {
+	if z.current != nil {
+		z.current.Close()
+		z.current = nil
+	}
+
+	if z.idx >= len(z.files) {
+		return nil, io.EOF
+	}
+
+	file := z.files[z.idx]
+	z.idx++
+
+	if file.FileInfo().IsDir() {
+		return &ArchiveEntry{Name: file.Name, IsDir: true}, nil
+	}
+
+	body, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Mode()&os.ModeSymlink != 0 {
+		defer body.Close()
+		linkTarget, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return &ArchiveEntry{
+			Name:       file.Name,
+			IsSymlink:  true,
+			LinkTarget: string(linkTarget),
+		}, nil
+	}
+
+	z.current = body
+
+	return &ArchiveEntry{
+		Name: file.Name,
+		Mode: file.Mode(),
+		Body: body,
+	}, nil
+}
+
+func (z *zipArchiveReader) Close() error {
+	if z.current != nil {
+		z.current.Close()
+	}
+	return z.rc.Close()
+}